@@ -5,11 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"time"
 
+	"github.com/mitchellh/packer/packer"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vapi/vcenter"
 	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 )
@@ -19,6 +23,8 @@ type Driver struct {
 	client     *govmomi.Client
 	finder     *find.Finder
 	datacenter *object.Datacenter
+	username   string
+	password   string
 }
 
 func NewDriver(config *ConnectConfig) (*Driver, error) {
@@ -46,6 +52,8 @@ func NewDriver(config *ConnectConfig) (*Driver, error) {
 		client:     client,
 		datacenter: datacenter,
 		finder:     finder,
+		username:   config.Username,
+		password:   config.Password,
 	}
 	return &d, nil
 }
@@ -118,6 +126,170 @@ func (d *Driver) CloneVM(config *CloneConfig) (*object.VirtualMachine, error) {
 	return vm, nil
 }
 
+func (d *Driver) CreateVM(config *CreateConfig) (*object.VirtualMachine, error) {
+	folder, err := d.finder.FolderOrDefault(d.ctx, fmt.Sprintf("/%v/vm/%v", d.datacenter.Name(), config.Folder))
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := d.finder.HostSystemOrDefault(d.ctx, config.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool *object.ResourcePool
+	if config.ResourcePool != "" {
+		pool, err = d.finder.ResourcePoolOrDefault(d.ctx, fmt.Sprintf("/%v/host/%v/Resources/%v", d.datacenter.Name(), config.Host, config.ResourcePool))
+	} else {
+		pool, err = d.finder.ResourcePoolOrDefault(d.ctx, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	datastore, err := d.finder.DatastoreOrDefault(d.ctx, config.Datastore)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := object.VirtualDeviceList{}
+
+	controller, err := devices.CreateSCSIController(config.DiskControllerType)
+	if err != nil {
+		return nil, err
+	}
+	devices = append(devices, controller)
+
+	disk := devices.CreateDisk(controller.(types.BaseVirtualController), datastore.Reference(), datastore.Path(fmt.Sprintf("%v/%v.vmdk", config.VMName, config.VMName)))
+	disk.CapacityInKB = config.DiskSize * 1024
+	if config.DiskThinProvisioned {
+		backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		backing.ThinProvisioned = types.NewBool(true)
+	}
+	devices = append(devices, disk)
+
+	network, err := d.finder.NetworkOrDefault(d.ctx, config.Network)
+	if err != nil {
+		return nil, err
+	}
+	backing, err := network.EthernetCardBackingInfo(d.ctx)
+	if err != nil {
+		return nil, err
+	}
+	nic, err := object.EthernetCardTypes().CreateEthernetCard(config.NetworkCard, backing)
+	if err != nil {
+		return nil, err
+	}
+	devices = append(devices, nic)
+
+	deviceChanges, err := devices.ConfigSpec(types.VirtualDeviceConfigSpecOperationAdd)
+	if err != nil {
+		return nil, err
+	}
+
+	var confSpec types.VirtualMachineConfigSpec
+	confSpec.Name = config.VMName
+	confSpec.Annotation = config.Annotation
+	confSpec.NumCPUs = config.CPUs
+	confSpec.MemoryMB = config.RAM
+	confSpec.GuestId = config.GuestOS
+	confSpec.Files = &types.VirtualMachineFileInfo{
+		VmPathName: fmt.Sprintf("[%v]", datastore.Name()),
+	}
+	confSpec.DeviceChange = deviceChanges
+
+	task, err := folder.CreateVM(d.ctx, confSpec, pool, host)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := task.WaitForResult(d.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := object.NewVirtualMachine(d.client.Client, info.Result.(types.ManagedObjectReference))
+	return vm, nil
+}
+
+func (d *Driver) DeployFromContentLibrary(config *ContentLibraryConfig) (*object.VirtualMachine, error) {
+	restClient := rest.NewClient(d.client.Client)
+	err := restClient.Login(d.ctx, url.UserPassword(d.username, d.password))
+	if err != nil {
+		return nil, err
+	}
+	defer restClient.Logout(d.ctx)
+
+	libManager := library.NewManager(restClient)
+	lib, err := libManager.GetLibraryByName(d.ctx, config.LibraryName)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := libManager.FindLibraryItems(d.ctx, library.FindItem{
+		LibraryID: lib.ID,
+		Name:      config.ItemName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(item) == 0 {
+		return nil, fmt.Errorf("item '%v' not found in library '%v'", config.ItemName, config.LibraryName)
+	}
+
+	folder, err := d.finder.FolderOrDefault(d.ctx, fmt.Sprintf("/%v/vm/%v", d.datacenter.Name(), config.Folder))
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := d.finder.HostSystemOrDefault(d.ctx, config.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool *object.ResourcePool
+	if config.ResourcePool != "" {
+		pool, err = d.finder.ResourcePoolOrDefault(d.ctx, fmt.Sprintf("/%v/host/%v/Resources/%v", d.datacenter.Name(), config.Host, config.ResourcePool))
+	} else {
+		pool, err = d.finder.ResourcePoolOrDefault(d.ctx, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	datastore, err := d.finder.DatastoreOrDefault(d.ctx, config.Datastore)
+	if err != nil {
+		return nil, err
+	}
+
+	folderRef := folder.Reference()
+	hostRef := host.Reference()
+	poolRef := pool.Reference()
+	datastoreRef := datastore.Reference()
+
+	deploy := vcenter.Deploy{
+		DeploymentSpec: vcenter.DeploymentSpec{
+			Name:               config.VMName,
+			DefaultDatastoreID: datastoreRef.Value,
+			AcceptAllEULA:      true,
+		},
+		Target: vcenter.Target{
+			ResourcePoolID: poolRef.Value,
+			FolderID:       folderRef.Value,
+			HostID:         hostRef.Value,
+		},
+	}
+
+	vcManager := vcenter.NewManager(restClient)
+	ref, err := vcManager.DeployLibraryItem(d.ctx, item[0], deploy)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := object.NewVirtualMachine(d.client.Client, ref.Reference())
+	return vm, nil
+}
+
 func (d *Driver) DestroyVM(vm *object.VirtualMachine) error {
 	task, err := vm.Destroy(d.ctx)
 	if err != nil {
@@ -151,6 +323,192 @@ func (d *Driver) ConfigureVM(vm *object.VirtualMachine, config *HardwareConfig)
 	return err
 }
 
+func (d *Driver) ConfigureNetwork(vm *object.VirtualMachine, config *NetworkConfig) error {
+	devices, err := vm.Device(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	network, err := d.finder.NetworkOrDefault(d.ctx, config.Network)
+	if err != nil {
+		return err
+	}
+	backing, err := network.EthernetCardBackingInfo(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	var confSpec types.VirtualMachineConfigSpec
+
+	existing := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	if len(existing) > 0 {
+		card := existing[0].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+		card.Backing = backing
+		if config.MacAddress != "" {
+			card.MacAddress = config.MacAddress
+			card.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+		}
+
+		confSpec.DeviceChange = append(confSpec.DeviceChange, &types.VirtualDeviceConfigSpec{
+			Device:    existing[0],
+			Operation: types.VirtualDeviceConfigSpecOperationEdit,
+		})
+	} else {
+		nic, err := object.EthernetCardTypes().CreateEthernetCard(config.NetworkCard, backing)
+		if err != nil {
+			return err
+		}
+		if config.MacAddress != "" {
+			card := nic.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+			card.MacAddress = config.MacAddress
+			card.AddressType = string(types.VirtualEthernetCardMacTypeManual)
+		}
+
+		confSpec.DeviceChange = append(confSpec.DeviceChange, &types.VirtualDeviceConfigSpec{
+			Device:    nic,
+			Operation: types.VirtualDeviceConfigSpecOperationAdd,
+		})
+	}
+
+	task, err := vm.Reconfigure(d.ctx, confSpec)
+	if err != nil {
+		return err
+	}
+	_, err = task.WaitForResult(d.ctx, nil)
+	return err
+}
+
+func (d *Driver) AddDisk(vm *object.VirtualMachine, sizeKB int64, thin bool, controllerType string) error {
+	devices, err := vm.Device(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	controller := findSCSIControllerByType(devices, controllerType)
+	if controller == nil {
+		newController, err := devices.CreateSCSIController(controllerType)
+		if err != nil {
+			return err
+		}
+
+		if err := vm.AddDevice(d.ctx, newController); err != nil {
+			return err
+		}
+
+		devices, err = vm.Device(d.ctx)
+		if err != nil {
+			return err
+		}
+		controller = findSCSIControllerByType(devices, controllerType)
+		if controller == nil {
+			return fmt.Errorf("controller of type '%v' not found after creation", controllerType)
+		}
+	}
+
+	disk := devices.CreateDisk(controller, types.ManagedObjectReference{}, "")
+	disk.CapacityInKB = sizeKB
+	if thin {
+		backing := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo)
+		backing.ThinProvisioned = types.NewBool(true)
+	}
+	devices.AssignController(disk, controller)
+
+	return vm.AddDevice(d.ctx, disk)
+}
+
+func (d *Driver) ResizeDisk(vm *object.VirtualMachine, diskLabel string, newSizeKB int64) error {
+	devices, err := vm.Device(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	disk, err := findDiskByLabel(devices, diskLabel)
+	if err != nil {
+		return err
+	}
+	disk.CapacityInKB = newSizeKB
+
+	confSpec := types.VirtualMachineConfigSpec{
+		DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+			&types.VirtualDeviceConfigSpec{
+				Device:    disk,
+				Operation: types.VirtualDeviceConfigSpecOperationEdit,
+			},
+		},
+	}
+
+	task, err := vm.Reconfigure(d.ctx, confSpec)
+	if err != nil {
+		return err
+	}
+	_, err = task.WaitForResult(d.ctx, nil)
+	return err
+}
+
+func (d *Driver) RemoveDisk(vm *object.VirtualMachine, diskLabel string, deleteFiles bool) error {
+	devices, err := vm.Device(d.ctx)
+	if err != nil {
+		return err
+	}
+
+	disk, err := findDiskByLabel(devices, diskLabel)
+	if err != nil {
+		return err
+	}
+
+	fileOperation := types.VirtualDeviceConfigSpecFileOperationDestroy
+	confSpec := types.VirtualMachineConfigSpec{
+		DeviceChange: []types.BaseVirtualDeviceConfigSpec{
+			&types.VirtualDeviceConfigSpec{
+				Device:    disk,
+				Operation: types.VirtualDeviceConfigSpecOperationRemove,
+			},
+		},
+	}
+	if deleteFiles {
+		confSpec.DeviceChange[0].(*types.VirtualDeviceConfigSpec).FileOperation = fileOperation
+	}
+
+	task, err := vm.Reconfigure(d.ctx, confSpec)
+	if err != nil {
+		return err
+	}
+	_, err = task.WaitForResult(d.ctx, nil)
+	return err
+}
+
+func findSCSIControllerByType(devices object.VirtualDeviceList, controllerType string) types.BaseVirtualController {
+	for _, device := range devices.SelectByType((*types.VirtualSCSIController)(nil)) {
+		var match bool
+		switch controllerType {
+		case "pvscsi":
+			_, match = device.(*types.ParaVirtualSCSIController)
+		case "lsilogic":
+			_, match = device.(*types.VirtualLsiLogicController)
+		case "lsilogic-sas":
+			_, match = device.(*types.VirtualLsiLogicSASController)
+		case "buslogic":
+			_, match = device.(*types.VirtualBusLogicController)
+		default:
+			match = true
+		}
+		if match {
+			return device.(types.BaseVirtualController)
+		}
+	}
+	return nil
+}
+
+func findDiskByLabel(devices object.VirtualDeviceList, label string) (*types.VirtualDisk, error) {
+	for _, device := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		info := device.GetVirtualDevice().DeviceInfo.GetDescription()
+		if info != nil && info.Label == label {
+			return device.(*types.VirtualDisk), nil
+		}
+	}
+	return nil, fmt.Errorf("disk '%v' not found", label)
+}
+
 func (d *Driver) PowerOn(vm *object.VirtualMachine) error {
 	task, err := vm.PowerOn(d.ctx)
 	if err != nil {
@@ -160,6 +518,73 @@ func (d *Driver) PowerOn(vm *object.VirtualMachine) error {
 	return err
 }
 
+func (d *Driver) CustomizeGuest(vm *object.VirtualMachine, config *CustomizeConfig) error {
+	dnsServers := config.DNSServers
+	if len(dnsServers) == 0 {
+		dnsServers = []string{"8.8.8.8", "8.8.4.4"}
+	}
+
+	globalIPSettings := types.CustomizationGlobalIPSettings{
+		DnsServerList: dnsServers,
+		DnsSuffixList: config.DNSSuffixes,
+	}
+
+	adapterMappings := make([]types.CustomizationAdapterMapping, len(config.NetworkInterfaces))
+	for i, nic := range config.NetworkInterfaces {
+		settings := types.CustomizationIPSettings{
+			Ip: &types.CustomizationFixedIp{
+				IpAddress: nic.IPAddress,
+			},
+			SubnetMask: nic.SubnetMask,
+		}
+		if config.Gateway != "" {
+			settings.Gateway = []string{config.Gateway}
+		}
+		adapterMappings[i] = types.CustomizationAdapterMapping{Adapter: settings}
+	}
+
+	var identity types.BaseCustomizationIdentitySettings
+	if config.Windows {
+		identity = &types.CustomizationSysprep{
+			GuiUnattended: types.CustomizationGuiUnattended{
+				AutoLogon: false,
+				TimeZone:  85,
+			},
+			Identification: types.CustomizationIdentification{},
+			UserData: types.CustomizationUserData{
+				ComputerName: &types.CustomizationFixedName{
+					Name: config.Hostname,
+				},
+				FullName:  "Administrator",
+				OrgName:   "Packer",
+				ProductId: "",
+			},
+		}
+	} else {
+		identity = &types.CustomizationLinuxPrep{
+			HostName: &types.CustomizationFixedName{
+				Name: config.Hostname,
+			},
+			Domain:     config.Domain,
+			TimeZone:   "UTC",
+			HwClockUTC: types.NewBool(true),
+		}
+	}
+
+	spec := types.CustomizationSpec{
+		Identity:         identity,
+		GlobalIPSettings: globalIPSettings,
+		NicSettingMap:    adapterMappings,
+	}
+
+	task, err := vm.Customize(d.ctx, spec)
+	if err != nil {
+		return err
+	}
+	_, err = task.WaitForResult(d.ctx, nil)
+	return err
+}
+
 func (d *Driver) WaitForIP(vm *object.VirtualMachine) (string, error) {
 	ip, err := vm.WaitForIP(d.ctx)
 	if err != nil {
@@ -186,31 +611,50 @@ func (d *Driver) PowerOff(vm *object.VirtualMachine) error {
 	return err
 }
 
-func (d *Driver) StartShutdown(vm *object.VirtualMachine) error {
-	err := vm.ShutdownGuest(d.ctx)
-	return err
-}
+func (d *Driver) Shutdown(vm *object.VirtualMachine, opts ShutdownOptions) error {
+	var mvm mo.VirtualMachine
+	err := vm.Properties(d.ctx, vm.Reference(), []string{"guest.toolsRunningStatus"}, &mvm)
+	if err != nil {
+		return err
+	}
 
-func (d *Driver) WaitForShutdown(vm *object.VirtualMachine, timeout time.Duration) error {
-	shutdownTimer := time.After(timeout)
-	for {
-		powerState, err := vm.PowerState(d.ctx)
-		if err != nil {
+	toolsRunning := mvm.Guest != nil && mvm.Guest.ToolsRunningStatus == string(types.VirtualMachineToolsRunningStatusGuestToolsRunning)
+
+	if toolsRunning {
+		if err := vm.ShutdownGuest(d.ctx); err != nil {
 			return err
 		}
-		if powerState == "poweredOff" {
-			break
+	} else if opts.ShutdownCommand != "" && opts.Comm != nil {
+		cmd := &packer.RemoteCmd{Command: opts.ShutdownCommand}
+		if err := cmd.StartWithUi(opts.Comm, opts.Ui); err != nil {
+			// The shutdown command often tears down the connection as the
+			// guest powers off; treat that as expected and let the
+			// property.Wait timeout below drive the PowerOff fallback.
+			opts.Ui.Say(fmt.Sprintf("Shutdown command connection closed: %v", err))
 		}
+	}
 
-		select {
-		case <-shutdownTimer:
-			err := errors.New("Timeout while waiting for machine to shut down.")
-			return err
-		default:
-			time.Sleep(1 * time.Second)
+	waitCtx, cancel := context.WithTimeout(d.ctx, opts.Timeout)
+	defer cancel()
+
+	pc := property.DefaultCollector(d.client.Client)
+	err = property.Wait(waitCtx, pc, vm.Reference(), []string{"runtime.powerState"}, func(changes []types.PropertyChange) bool {
+		for _, change := range changes {
+			state, ok := change.Val.(types.VirtualMachinePowerState)
+			if ok && state == types.VirtualMachinePowerStatePoweredOff {
+				return true
+			}
 		}
+		return false
+	})
+	if err == nil {
+		return nil
 	}
-	return nil
+
+	if toolsRunning || (opts.ShutdownCommand != "" && opts.Comm != nil) {
+		opts.Ui.Say("Guest did not shut down in time; forcing power off...")
+	}
+	return d.PowerOff(vm)
 }
 
 func (d *Driver) CreateSnapshot(vm *object.VirtualMachine) error {
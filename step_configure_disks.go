@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/vmware/govmomi/object"
+)
+
+type DiskConfig struct {
+	DiskSize            int64  `mapstructure:"disk_size"`
+	DiskThinProvisioned bool   `mapstructure:"disk_thin_provisioned"`
+	DiskControllerType  string `mapstructure:"disk_controller_type"`
+}
+
+type StepConfigureDisks struct {
+	Config []DiskConfig
+}
+
+func (s *StepConfigureDisks) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if len(s.Config) == 0 {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+	vm := state.Get("vm").(*object.VirtualMachine)
+
+	ui.Say("Configuring additional disks...")
+
+	for _, disk := range s.Config {
+		err := d.AddDisk(vm, disk.DiskSize*1024, disk.DiskThinProvisioned, disk.DiskControllerType)
+		if err != nil {
+			state.Put("error", fmt.Errorf("error adding disk: %v", err))
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepConfigureDisks) Cleanup(multistep.StateBag) {}
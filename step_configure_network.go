@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/vmware/govmomi/object"
+)
+
+type NetworkConfig struct {
+	Network     string `mapstructure:"network"`
+	NetworkCard string `mapstructure:"network_card"`
+	MacAddress  string `mapstructure:"mac_address"`
+}
+
+type StepConfigureNetwork struct {
+	Config *NetworkConfig
+}
+
+func (s *StepConfigureNetwork) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Config.Network == "" {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+	vm := state.Get("vm").(*object.VirtualMachine)
+
+	ui.Say("Configuring network adapter...")
+
+	err := d.ConfigureNetwork(vm, s.Config)
+	if err != nil {
+		state.Put("error", fmt.Errorf("error configuring network: %v", err))
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepConfigureNetwork) Cleanup(multistep.StateBag) {}
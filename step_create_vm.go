@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/vmware/govmomi/object"
+)
+
+type CreateConfig struct {
+	HardwareConfig
+
+	GuestOS             string `mapstructure:"guest_os_type"`
+	Annotation          string `mapstructure:"notes"`
+	DiskSize            int64  `mapstructure:"disk_size"`
+	DiskThinProvisioned bool   `mapstructure:"disk_thin_provisioned"`
+	DiskControllerType  string `mapstructure:"disk_controller_type"`
+	NetworkCard         string `mapstructure:"network_card"`
+	Network             string `mapstructure:"network"`
+
+	Folder       string `mapstructure:"folder"`
+	Host         string `mapstructure:"host"`
+	ResourcePool string `mapstructure:"resource_pool"`
+	Datastore    string `mapstructure:"datastore"`
+	VMName       string `mapstructure:"vm_name"`
+}
+
+type StepCreateVM struct {
+	Config *CreateConfig
+}
+
+func (s *StepCreateVM) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+
+	ui.Say("Creating VM...")
+
+	vm, err := d.CreateVM(s.Config)
+	if err != nil {
+		state.Put("error", fmt.Errorf("error creating vm: %v", err))
+		return multistep.ActionHalt
+	}
+
+	state.Put("vm", vm)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateVM) Cleanup(state multistep.StateBag) {
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !cancelled && !halted {
+		return
+	}
+
+	vmRaw, ok := state.GetOk("vm")
+	if !ok {
+		return
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+	vm := vmRaw.(*object.VirtualMachine)
+
+	ui.Say("Deleting VM...")
+	err := d.DestroyVM(vm)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error deleting VM: %v", err))
+	}
+}
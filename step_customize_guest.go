@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/vmware/govmomi/object"
+)
+
+type NetworkInterfaceConfig struct {
+	IPAddress  string `mapstructure:"ip_address"`
+	SubnetMask string `mapstructure:"subnet_mask"`
+}
+
+type CustomizeConfig struct {
+	Hostname          string                   `mapstructure:"customize_hostname"`
+	Domain            string                   `mapstructure:"customize_domain"`
+	DNSServers        []string                 `mapstructure:"customize_dns_servers"`
+	DNSSuffixes       []string                 `mapstructure:"customize_dns_suffixes"`
+	Gateway           string                   `mapstructure:"customize_gateway"`
+	NetworkInterfaces []NetworkInterfaceConfig `mapstructure:"customize_network_interfaces"`
+	Windows           bool                     `mapstructure:"customize_windows"`
+}
+
+type StepCustomizeGuest struct {
+	Config *CustomizeConfig
+}
+
+func (s *StepCustomizeGuest) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if s.Config == nil || s.Config.Hostname == "" {
+		return multistep.ActionContinue
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+	vm := state.Get("vm").(*object.VirtualMachine)
+
+	ui.Say("Customizing guest OS...")
+
+	err := d.CustomizeGuest(vm, s.Config)
+	if err != nil {
+		state.Put("error", fmt.Errorf("error customizing guest: %v", err))
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCustomizeGuest) Cleanup(multistep.StateBag) {}
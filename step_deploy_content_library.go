@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/vmware/govmomi/object"
+)
+
+type ContentLibraryConfig struct {
+	LibraryName string `mapstructure:"content_library"`
+	ItemName    string `mapstructure:"content_library_item"`
+
+	Folder       string `mapstructure:"folder"`
+	Host         string `mapstructure:"host"`
+	ResourcePool string `mapstructure:"resource_pool"`
+	Datastore    string `mapstructure:"datastore"`
+	VMName       string `mapstructure:"vm_name"`
+}
+
+type StepDeployFromContentLibrary struct {
+	Config *ContentLibraryConfig
+}
+
+func (s *StepDeployFromContentLibrary) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+
+	ui.Say(fmt.Sprintf("Deploying VM from content library item '%v'...", s.Config.ItemName))
+
+	vm, err := d.DeployFromContentLibrary(s.Config)
+	if err != nil {
+		state.Put("error", fmt.Errorf("error deploying from content library: %v", err))
+		return multistep.ActionHalt
+	}
+
+	state.Put("vm", vm)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepDeployFromContentLibrary) Cleanup(state multistep.StateBag) {
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !cancelled && !halted {
+		return
+	}
+
+	vmRaw, ok := state.GetOk("vm")
+	if !ok {
+		return
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+	vm := vmRaw.(*object.VirtualMachine)
+
+	ui.Say("Deleting VM...")
+	err := d.DestroyVM(vm)
+	if err != nil {
+		ui.Error(fmt.Sprintf("Error deleting VM: %v", err))
+	}
+}
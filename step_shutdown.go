@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/multistep"
+	"github.com/mitchellh/packer/packer"
+	"github.com/vmware/govmomi/object"
+)
+
+type ShutdownOptions struct {
+	ShutdownCommand string
+	Comm            packer.Communicator
+	Ui              packer.Ui
+	Timeout         time.Duration
+}
+
+type StepShutdown struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (s *StepShutdown) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	d := state.Get("driver").(*Driver)
+	vm := state.Get("vm").(*object.VirtualMachine)
+
+	ui.Say("Shutting down VM...")
+
+	var comm packer.Communicator
+	if raw, ok := state.GetOk("communicator"); ok {
+		comm = raw.(packer.Communicator)
+	}
+
+	opts := ShutdownOptions{
+		ShutdownCommand: s.Command,
+		Comm:            comm,
+		Ui:              ui,
+		Timeout:         s.Timeout,
+	}
+
+	err := d.Shutdown(vm, opts)
+	if err != nil {
+		state.Put("error", fmt.Errorf("error shutting down vm: %v", err))
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepShutdown) Cleanup(multistep.StateBag) {}